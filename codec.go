@@ -0,0 +1,181 @@
+package xweb
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v2"
+)
+
+// Encoder renders a Go value onto w in whatever wire format it implements.
+// App.RegisterCodec associates one with a content type for negotiation.
+type Encoder interface {
+	Encode(w io.Writer, v interface{}) error
+}
+
+// EncoderFunc lets a plain function satisfy Encoder.
+type EncoderFunc func(w io.Writer, v interface{}) error
+
+func (f EncoderFunc) Encode(w io.Writer, v interface{}) error { return f(w, v) }
+
+func jsonEncoder() Encoder {
+	return EncoderFunc(func(w io.Writer, v interface{}) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+func xmlEncoder() Encoder {
+	return EncoderFunc(func(w io.Writer, v interface{}) error {
+		return xml.NewEncoder(w).Encode(v)
+	})
+}
+
+func yamlEncoder() Encoder {
+	return EncoderFunc(func(w io.Writer, v interface{}) error {
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	})
+}
+
+func msgpackEncoder() Encoder {
+	return EncoderFunc(func(w io.Writer, v interface{}) error {
+		return msgpack.NewEncoder(w).Encode(v)
+	})
+}
+
+// RegisterCodec adds (or overrides) the Encoder used for contentType during
+// response negotiation. JSON, XML, YAML and MessagePack are registered by
+// default; see registerDefaultCodecs.
+func (a *App) RegisterCodec(contentType string, enc Encoder) {
+	if a.codecs == nil {
+		a.codecs = map[string]Encoder{}
+	}
+	a.codecs[contentType] = enc
+}
+
+// registerDefaultCodecs wires up the codecs every App starts with; called
+// from NewApp.
+func registerDefaultCodecs(a *App) {
+	a.RegisterCodec("application/json", jsonEncoder())
+	a.RegisterCodec("application/xml", xmlEncoder())
+	a.RegisterCodec("text/xml", xmlEncoder())
+	a.RegisterCodec("application/x-yaml", yamlEncoder())
+	a.RegisterCodec("application/msgpack", msgpackEncoder())
+}
+
+type acceptEntry struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header with optional quality values, e.g.
+// "application/json;q=0.9, text/xml;q=0.5", sorted best quality first.
+func parseAccept(header string) []acceptEntry {
+	if header == "" {
+		return nil
+	}
+	parts := strings.Split(header, ",")
+	entries := make([]acceptEntry, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		q := 1.0
+		mediaType := p
+		if i := strings.Index(p, ";"); i >= 0 {
+			mediaType = strings.TrimSpace(p[:i])
+			for _, param := range strings.Split(p[i+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+						q = v
+					}
+				}
+			}
+		}
+		entries = append(entries, acceptEntry{mediaType: mediaType, q: q})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+	return entries
+}
+
+func mediaTypeAllowed(mediaType string, produces []string) bool {
+	if len(produces) == 0 {
+		return true
+	}
+	for _, p := range produces {
+		if p == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedContentTypes returns codecs' keys in a fixed (alphabetical) order,
+// so a wildcard Accept match is deterministic instead of depending on Go's
+// randomized map iteration order.
+func sortedContentTypes(codecs map[string]Encoder) []string {
+	cts := make([]string, 0, len(codecs))
+	for ct := range codecs {
+		cts = append(cts, ct)
+	}
+	sort.Strings(cts)
+	return cts
+}
+
+// negotiate walks accept in quality order and returns the first registered
+// codec whose content-type matches (honoring "*/*" and "type/*" wildcards),
+// filtered by the action's Produces list when it has one. Wildcard matches
+// are resolved against sortedContentTypes rather than ranging the codecs
+// map directly, so the same request always negotiates the same codec.
+func negotiate(accept []acceptEntry, codecs map[string]Encoder, produces []string) (string, Encoder, bool) {
+	for _, e := range accept {
+		if e.mediaType == "*/*" {
+			for _, ct := range sortedContentTypes(codecs) {
+				if mediaTypeAllowed(ct, produces) {
+					return ct, codecs[ct], true
+				}
+			}
+			continue
+		}
+		if strings.HasSuffix(e.mediaType, "/*") {
+			prefix := strings.TrimSuffix(e.mediaType, "*")
+			for _, ct := range sortedContentTypes(codecs) {
+				if strings.HasPrefix(ct, prefix) && mediaTypeAllowed(ct, produces) {
+					return ct, codecs[ct], true
+				}
+			}
+			continue
+		}
+		if enc, ok := codecs[e.mediaType]; ok && mediaTypeAllowed(e.mediaType, produces) {
+			return e.mediaType, enc, true
+		}
+	}
+	return "", nil, false
+}
+
+// controllerProduces reads an optional `Produces() []string` method off the
+// controller, restricting which content types its route will negotiate.
+func controllerProduces(vc reflect.Value) []string {
+	m := vc.MethodByName("Produces")
+	if !m.IsValid() {
+		return nil
+	}
+	ret := m.Call(nil)
+	if len(ret) == 0 {
+		return nil
+	}
+	produces, _ := ret[0].Interface().([]string)
+	return produces
+}
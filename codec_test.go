@@ -0,0 +1,44 @@
+package xweb
+
+import "testing"
+
+func TestNegotiateWildcardIsDeterministic(t *testing.T) {
+	codecs := map[string]Encoder{
+		"application/json":    jsonEncoder(),
+		"application/xml":     xmlEncoder(),
+		"application/x-yaml":  yamlEncoder(),
+		"application/msgpack": msgpackEncoder(),
+	}
+
+	accept := []acceptEntry{{mediaType: "*/*", q: 1}}
+	ct, _, ok := negotiate(accept, codecs, nil)
+	if !ok {
+		t.Fatal("expected a codec match for */*")
+	}
+	for i := 0; i < 50; i++ {
+		got, _, ok := negotiate(accept, codecs, nil)
+		if !ok || got != ct {
+			t.Fatalf("negotiate(*/*) not deterministic: got %q, want %q", got, ct)
+		}
+	}
+}
+
+func TestNegotiatePartialWildcardIsDeterministic(t *testing.T) {
+	codecs := map[string]Encoder{
+		"application/json":    jsonEncoder(),
+		"application/xml":     xmlEncoder(),
+		"application/msgpack": msgpackEncoder(),
+	}
+
+	accept := []acceptEntry{{mediaType: "application/*", q: 1}}
+	ct, _, ok := negotiate(accept, codecs, nil)
+	if !ok {
+		t.Fatal("expected a codec match for application/*")
+	}
+	for i := 0; i < 50; i++ {
+		got, _, ok := negotiate(accept, codecs, nil)
+		if !ok || got != ct {
+			t.Fatalf("negotiate(application/*) not deterministic: got %q, want %q", got, ct)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package xweb
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+)
+
+// HTTPError is a typed failure carrying everything needed to render a
+// structured response: the status Code, a human Message, optional
+// machine-readable Detail, and the underlying Cause for logging. Returning
+// one from an action, or panicking with one, renders through App.OnError
+// (or the default negotiated renderer) instead of the old bare
+// "Server Error" string.
+type HTTPError struct {
+	Code    int
+	Message string
+	Detail  interface{}
+	Cause   error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error { return e.Cause }
+
+func newHTTPError(code int, message string, detail interface{}) *HTTPError {
+	return &HTTPError{Code: code, Message: message, Detail: detail}
+}
+
+func firstDetail(detail []interface{}) interface{} {
+	if len(detail) == 0 {
+		return nil
+	}
+	return detail[0]
+}
+
+// BadRequest, Unauthorized, Forbidden, NotFound and Conflict are the
+// typed helpers for the status codes actions hit most often; detail is
+// optional and becomes the problem-details "detail" field.
+func BadRequest(message string, detail ...interface{}) *HTTPError {
+	return newHTTPError(http.StatusBadRequest, message, firstDetail(detail))
+}
+
+func Unauthorized(message string, detail ...interface{}) *HTTPError {
+	return newHTTPError(http.StatusUnauthorized, message, firstDetail(detail))
+}
+
+func Forbidden(message string, detail ...interface{}) *HTTPError {
+	return newHTTPError(http.StatusForbidden, message, firstDetail(detail))
+}
+
+func NotFound(message string, detail ...interface{}) *HTTPError {
+	return newHTTPError(http.StatusNotFound, message, firstDetail(detail))
+}
+
+func Conflict(message string, detail ...interface{}) *HTTPError {
+	return newHTTPError(http.StatusConflict, message, firstDetail(detail))
+}
+
+// InternalServerError wraps cause for logging while keeping message as the
+// only thing ever rendered to the client.
+func InternalServerError(message string, cause error) *HTTPError {
+	return &HTTPError{Code: http.StatusInternalServerError, Message: message, Cause: cause}
+}
+
+// asHTTPError normalizes any error into an *HTTPError, wrapping unknown
+// ones as a 500 so every failure path renders the same shape.
+func asHTTPError(err error) *HTTPError {
+	if herr, ok := err.(*HTTPError); ok {
+		return herr
+	}
+	return InternalServerError("Server Error", err)
+}
+
+// problemDetails is the RFC 7807 shape the default JSON/XML renderers emit.
+type problemDetails struct {
+	Type     string      `json:"type,omitempty" xml:"type,omitempty"`
+	Title    string      `json:"title" xml:"title"`
+	Status   int         `json:"status" xml:"status"`
+	Detail   interface{} `json:"detail,omitempty" xml:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty" xml:"instance,omitempty"`
+}
+
+// handleError is the single path every failure in actionHandler.serve
+// funnels through: a user-registered App.OnError gets first refusal,
+// falling back to renderError.
+func (a *App) handleError(c *Action, err error) {
+	herr := asHTTPError(err)
+	c.GetLogger().Println(herr)
+
+	if a.OnError != nil {
+		a.OnError(c, herr)
+		return
+	}
+	a.renderError(c, herr)
+}
+
+// renderError is the default renderer: a codec-negotiated problem-details
+// body for API clients, falling back to a plain HTML error page -- the
+// same negotiation serve already does for successful struct/map/slice
+// responses.
+func (a *App) renderError(c *Action, herr *HTTPError) {
+	w := c.ResponseWriter
+	accept := parseAccept(c.Request.Header.Get("Accept"))
+	if len(accept) == 0 {
+		accept = []acceptEntry{{mediaType: "text/html", q: 1}}
+	}
+
+	problem := problemDetails{
+		Title:    herr.Message,
+		Status:   herr.Code,
+		Detail:   herr.Detail,
+		Instance: c.Request.URL.Path,
+	}
+
+	if ct, enc, ok := negotiate(accept, a.codecs, nil); ok && ct != "text/html" {
+		w.Header().Set("Content-Type", ct)
+		w.WriteHeader(herr.Code)
+		enc.Encode(w, problem)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(herr.Code)
+	fmt.Fprintf(w, "<h1>%d %s</h1>", herr.Code, html.EscapeString(herr.Message))
+}
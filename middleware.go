@@ -0,0 +1,276 @@
+package xweb
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// HandlerFunc is the signature a Middleware wraps. It mirrors handler.Do so
+// middleware can sit in front of any Routes handler, not just actions.
+type HandlerFunc func(http.ResponseWriter, *http.Request) error
+
+// Middleware takes the next handler in the chain and returns a handler that
+// wraps it, the same shape used by go-restful/mux/gorilla style stacks.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Use registers global middleware that runs, in order, around every route
+// dispatched by app.Routes. actionHandler.chain folds it into the per-route
+// chain it memoizes; Routes.handle wraps every other handler kind (static,
+// WebDAV, WebSocket) with runWithGlobalMiddleware so the same guarantee
+// holds regardless of which handler a route resolves to.
+func (a *App) Use(mw ...Middleware) {
+	a.middlewares = append(a.middlewares, mw...)
+}
+
+// runWithGlobalMiddleware wraps final with the app-wide middleware
+// registered via Use and runs it. actionHandler builds and caches its own
+// chain (global + per-route) once per route; the other handler kinds have
+// no per-route middleware of their own, so Routes.handle calls this around
+// them directly instead of needing a cached chain per handler.
+func (a *App) runWithGlobalMiddleware(w http.ResponseWriter, req *http.Request, final HandlerFunc) error {
+	chained := final
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		chained = a.middlewares[i](chained)
+	}
+	return chained(w, req)
+}
+
+// RouteBuilder lets callers attach per-route middleware to a just-registered
+// action, e.g. app.Routes.Handle(methods, pattern, ctype, action).With(mw...).
+type RouteBuilder struct {
+	handler *actionHandler
+}
+
+// With appends middleware that only runs for this route, after the global
+// ones registered via App.Use. Panics if the route Handle built this
+// builder for has no middleware chain of its own (currently only true for
+// WebSocket actions), rather than silently attaching to an unrelated route
+// or nil-dereferencing with an unhelpful message.
+func (b *RouteBuilder) With(mw ...Middleware) *RouteBuilder {
+	if b.handler == nil {
+		panic("xweb: .With(...) is not supported on this route (e.g. WebSocket actions have no middleware chain)")
+	}
+	b.handler.middlewares = append(b.handler.middlewares, mw...)
+	return b
+}
+
+// Handle registers an action under pattern restricted to methods and returns
+// a builder so the caller can attach per-route middleware. It supersedes the
+// bare addAction call for anyone that needs .With(...). r.lastAdded is
+// always set or cleared by addAction for the route just registered, so the
+// builder never points at a stale, unrelated handler.
+func (r *Routes) Handle(methods map[string]bool, pattern string, ctype reflect.Type, actionName string) *RouteBuilder {
+	if err := r.addAction(pattern, methods, ctype, actionName); err != nil {
+		panic(err)
+	}
+	return &RouteBuilder{handler: r.lastAdded}
+}
+
+type matchParamsKeyType struct{}
+
+var matchParamsKey = matchParamsKeyType{}
+
+func newMatchContext(ctx context.Context, match []string) context.Context {
+	return context.WithValue(ctx, matchParamsKey, match)
+}
+
+func matchParamsFromContext(req *http.Request) []string {
+	if v, ok := req.Context().Value(matchParamsKey).([]string); ok {
+		return v
+	}
+	return nil
+}
+
+type namedParamsKeyType struct{}
+
+var namedParamsKey = namedParamsKeyType{}
+
+func newParamsContext(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, namedParamsKey, params)
+}
+
+// paramsFromContext returns the named path parameters the route trie
+// matched for this request, for assignment into Action.Params.
+func paramsFromContext(req *http.Request) map[string]string {
+	if v, ok := req.Context().Value(namedParamsKey).(map[string]string); ok {
+		return v
+	}
+	return map[string]string{}
+}
+
+// chain builds (and memoizes) the effective middleware chain for this route:
+// global App middleware first, then the route's own, wrapped around serve.
+func (h *actionHandler) chain() HandlerFunc {
+	h.chainOnce.Do(func() {
+		final := HandlerFunc(h.serve)
+		all := make([]Middleware, 0, len(h.app.middlewares)+len(h.middlewares))
+		all = append(all, h.app.middlewares...)
+		all = append(all, h.middlewares...)
+		for i := len(all) - 1; i >= 0; i-- {
+			final = all[i](final)
+		}
+		h.chained = final
+	})
+	return h.chained
+}
+
+// RecoveryMiddleware turns panics anywhere later in the chain into a 500
+// instead of taking down the server. The panic value and stack trace are
+// returned as the chain's error; the middleware does not log them itself.
+func RecoveryMiddleware(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				buf := make([]byte, 4096)
+				n := runtime.Stack(buf, false)
+				err = fmt.Errorf("panic: %v\n%s", rec, buf[:n])
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Server Error"))
+			}
+		}()
+		return next(w, req)
+	}
+}
+
+// LoggingMiddleware writes one line per request to logger.
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) error {
+			err := next(w, req)
+			if logger != nil {
+				logger.Println(req.Method, req.URL.Path)
+			}
+			return err
+		}
+	}
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+// WriteHeader and Write drop any Content-Length the wrapped handler set,
+// since it describes the uncompressed body.
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	g.Header().Del("Content-Length")
+	return g.gz.Write(b)
+}
+
+// GzipMiddleware generalizes the compression staticHandler already does for
+// static assets to any dynamic response, when the client advertises gzip.
+func GzipMiddleware(next HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			return next(w, req)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		return next(&gzipResponseWriter{ResponseWriter: w, gz: gz}, req)
+	}
+}
+
+// CORSConfig controls the headers CORSMiddleware emits. AllowedOrigins is
+// matched against each request's own Origin header -- "*" matches any
+// origin, otherwise an exact match is echoed back. Access-Control-Allow-Origin
+// must be a single origin (or "*"), never a comma-joined list, so unlike
+// AllowedMethods/AllowedHeaders this field can't just be joined verbatim.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+func (cfg CORSConfig) allowOrigin(origin string) string {
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			return "*"
+		}
+		if o == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// CORSMiddleware returns middleware answering preflight requests and
+// stamping CORS headers on every response per cfg. The Origin header is
+// checked against cfg.AllowedOrigins and echoed back rather than joined, so
+// multi-origin configs produce a valid single-origin header value instead
+// of one the browser rejects outright.
+func CORSMiddleware(cfg CORSConfig) Middleware {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) error {
+			allowed := cfg.allowOrigin(req.Header.Get("Origin"))
+			if allowed == "" {
+				return next(w, req)
+			}
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if req.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusNoContent)
+				return nil
+			}
+			return next(w, req)
+		}
+	}
+}
+
+// XSRFMiddleware is the XSRF check actionHandler.serve used to run inline
+// for every POST action, pulled out so routes opt in instead of being
+// unconditionally subject to it: attach it with
+// RouteBuilder.With(XSRFMiddleware(app)) on the actions that take
+// state-changing form input. Routes that never call .With -- WebDAV,
+// static files, WebSocket upgrades, or any action that doesn't need it --
+// are exempt simply by not attaching it. app.AppConfig.CheckXrsf remains
+// the master off-switch even for routes that do attach it.
+func XSRFMiddleware(app *App) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) error {
+			if !app.AppConfig.CheckXrsf || req.Method != "POST" {
+				return next(w, req)
+			}
+
+			// Mirrors actionHandler.serve's own form parsing: this runs
+			// ahead of it in the chain, so the cookie/form comparison below
+			// needs req.Form populated itself. ParseForm/ParseMultipartForm
+			// are cheap to call again once serve does its own parsing.
+			if strings.Contains(req.Header.Get("Content-Type"), "multipart/form-data") {
+				req.ParseMultipartForm(app.AppConfig.MaxUploadSize)
+			} else {
+				req.ParseForm()
+			}
+
+			cookie, err := req.Cookie(XSRF_TAG)
+			var formVal string
+			if formVals := req.Form[XSRF_TAG]; len(formVals) > 0 {
+				formVal = formVals[0]
+			}
+			if err != nil || cookie.Value == "" || cookie.Value != formVal {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("xrsf error."))
+				return nil
+			}
+			return next(w, req)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package xweb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddlewareEchoesMatchingOrigin(t *testing.T) {
+	mw := CORSMiddleware(CORSConfig{AllowedOrigins: []string{"https://a.example", "https://b.example"}})
+	h := mw(func(w http.ResponseWriter, req *http.Request) error { return nil })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://b.example")
+	w := httptest.NewRecorder()
+	if err := h(w, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://b.example" {
+		t.Fatalf("expected the matching origin to be echoed back alone, got %q", got)
+	}
+}
+
+func TestCORSMiddlewareOmitsHeaderForUnknownOrigin(t *testing.T) {
+	mw := CORSMiddleware(CORSConfig{AllowedOrigins: []string{"https://a.example"}})
+	h := mw(func(w http.ResponseWriter, req *http.Request) error { return nil })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	if err := h(w, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected no CORS header for an origin not in AllowedOrigins, got %q", got)
+	}
+}
@@ -1,14 +1,15 @@
 package xweb
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
 	"os"
 	"path"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -46,13 +47,26 @@ func (h *staticHandler) Do(w http.ResponseWriter, req *http.Request) error {
 			return errors.New("unsupported serve dir")
 		}
 
-		a.ContentEncoding = GetAcceptEncodingZip(req)
-		memzipfile, err := OpenMemZipFile(staticFile, a.ContentEncoding)
+		encoding := negotiateEncoding(req)
+		a.ContentEncoding = encoding
+
+		a.initStaticCache()
+		content, etag, err := a.loadCompressed(staticFile, finfo, encoding)
 		if err != nil {
 			return err
 		}
-		a.InitHeadContent(w, finfo.Size())
-		http.ServeContent(w, req, staticFile, finfo.ModTime(), memzipfile)
+
+		w.Header().Set("ETag", etag)
+		if inm := req.Header.Get("If-None-Match"); inm != "" && inm == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		a.InitHeadContent(w, int64(len(content)))
+		http.ServeContent(w, req, staticFile, finfo.ModTime(), bytes.NewReader(content))
 	} else {
 		http.ServeFile(w, req, staticFile)
 	}
@@ -62,9 +76,15 @@ func (h *staticHandler) Do(w http.ResponseWriter, req *http.Request) error {
 type actionHandler struct {
 	app     *App
 	methods map[string]bool
-	cr      *regexp.Regexp
 	ctype   reflect.Type
 	handler string
+
+	// middlewares holds the per-route chain attached via RouteBuilder.With;
+	// App.middlewares (global) runs ahead of these. The combined chain is
+	// built once and cached, so registration cost isn't paid per request.
+	middlewares []Middleware
+	chainOnce   sync.Once
+	chained     HandlerFunc
 }
 
 func (h *actionHandler) Do(w http.ResponseWriter, req *http.Request) error {
@@ -72,6 +92,30 @@ func (h *actionHandler) Do(w http.ResponseWriter, req *http.Request) error {
 }
 
 func (h *actionHandler) DoCr(w http.ResponseWriter, req *http.Request, match []string) error {
+	return h.DoParams(w, req, match, nil)
+}
+
+// DoParams is what the route trie calls: positional carries the matched
+// segments in pattern order (for handlers that still take them like
+// match[1:] did), named carries the same values keyed by {name} for
+// c.Params.
+func (h *actionHandler) DoParams(w http.ResponseWriter, req *http.Request, positional []string, named map[string]string) error {
+	ctx := req.Context()
+	if len(positional) > 0 {
+		ctx = newMatchContext(ctx, positional)
+	}
+	if len(named) > 0 {
+		ctx = newParamsContext(ctx, named)
+	}
+	req = req.WithContext(ctx)
+	return h.chain()(w, req)
+}
+
+// serve is the actual action dispatch, run as the innermost link of the
+// middleware chain built by actionHandler.chain.
+func (h *actionHandler) serve(w http.ResponseWriter, req *http.Request) error {
+	match := matchParamsFromContext(req)
+
 	//log the request
 	//var logEntry bytes.Buffer
 	a := h.app
@@ -93,26 +137,12 @@ func (h *actionHandler) DoCr(w http.ResponseWriter, req *http.Request, match []s
 
 	//requestPath := req.URL.Path
 
-	if a.AppConfig.CheckXrsf && req.Method == "POST" {
-		res, err := req.Cookie(XSRF_TAG)
-		formVals := req.Form[XSRF_TAG]
-		var formVal string
-		if len(formVals) > 0 {
-			formVal = formVals[0]
-		}
-		if err != nil || res.Value == "" || res.Value != formVal {
-			w.WriteHeader(500)
-			w.Write([]byte("xrsf error."))
-			return nil
-		}
-	}
-
 	var args []reflect.Value
 	for _, arg := range match {
 		args = append(args, reflect.ValueOf(arg))
 	}
 	vc := reflect.New(h.ctype)
-	c := Action{Request: req, App: a, ResponseWriter: w, T: T{}, f: T{}}
+	c := Action{Request: req, App: a, ResponseWriter: w, T: T{}, f: T{}, Params: paramsFromContext(req)}
 	for k, v := range a.VarMaps {
 		c.T[k] = v
 	}
@@ -145,9 +175,8 @@ func (h *actionHandler) DoCr(w http.ResponseWriter, req *http.Request, match []s
 
 	ret, err := a.safelyCall(vc, h.handler, args)
 	if err != nil {
-		c.GetLogger().Println(err)
 		//there was an error or panic while calling the handler
-		c.Abort(500, "Server Error")
+		a.handleError(&c, err)
 		return nil
 	}
 
@@ -171,9 +200,28 @@ func (h *actionHandler) DoCr(w http.ResponseWriter, req *http.Request, match []s
 	} else if sval.Kind() == reflect.Slice && sval.Type().Elem().Kind() == reflect.Uint8 {
 		content = sval.Interface().([]byte)
 	} else if e, ok := sval.Interface().(error); ok && e != nil {
-		c.GetLogger().Println(e)
-		c.Abort(500, "Server Error")
+		a.handleError(&c, e)
 		return nil
+	} else {
+		// Anything else (struct, map, slice, ...) goes through content
+		// negotiation against the registered codecs instead of the plain
+		// text/html path above.
+		accept := parseAccept(req.Header.Get("Accept"))
+		if len(accept) == 0 {
+			accept = []acceptEntry{{mediaType: "*/*", q: 1}}
+		}
+		ct, enc, ok := negotiate(accept, a.codecs, controllerProduces(vc))
+		if !ok {
+			a.handleError(&c, newHTTPError(http.StatusNotAcceptable, "Not Acceptable", nil))
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := enc.Encode(&buf, sval.Interface()); err != nil {
+			a.handleError(&c, err)
+			return nil
+		}
+		c.SetHeader("Content-Type", ct)
+		content = buf.Bytes()
 	}
 
 	c.SetHeader("Content-Length", strconv.Itoa(len(content)))
@@ -184,51 +232,60 @@ func (h *actionHandler) DoCr(w http.ResponseWriter, req *http.Request, match []s
 	return nil
 }
 
+// errorHandler renders a fixed HTTPError, independent of any action having
+// run -- Routes.handle uses it for the 404/405 cases that never reach
+// actionHandler.serve.
 type errorHandler struct {
 	app *App
-	err *AbortError
+	err *HTTPError
+}
+
+func (h *errorHandler) Do(w http.ResponseWriter, req *http.Request) error {
+	c := &Action{Request: req, App: h.app, ResponseWriter: w, T: T{}, f: T{}}
+	h.app.renderError(c, h.err)
+	return nil
 }
 
 type Routes struct {
 	app          *App
-	mapRoutes    map[string]handler
-	rgRoutes     []*actionHandler
+	tree         *routeTree
 	defaultIndex []string
+
+	// lastAdded is the actionHandler registered by the most recent addAction
+	// call, so Handle can hand it back wrapped in a RouteBuilder.
+	lastAdded *actionHandler
 }
 
 func NewRoutes(app *App, defaultHome []string) *Routes {
-	return &Routes{app, make(map[string]handler),
-		make([]*actionHandler, 0), defaultHome,
-	}
+	return &Routes{app, newRouteTree(), defaultHome, nil}
 }
 
 func (r *Routes) addStatic(s string, handler handler) error {
-	r.mapRoutes[s] = handler
-	return nil
+	return r.tree.insert(s, nil, handler)
 }
 
 func NewActionHandler(app *App, ctype reflect.Type, handler string) *actionHandler {
 	return &actionHandler{app: app, ctype: ctype, handler: handler}
 }
 
-// there are two kind of routes. one is accurate route, we use map. another is
-// regex route, we use slice.
+// addAction compiles pattern into the route trie, accepting both named
+// parameters (`/user/{id:int}`) and the legacy `*`/`?` glob syntax, which is
+// translated down to the same tree nodes. An action shaped like
+// `func(ws *websocket.Conn)` is recognized as a WebSocket endpoint and
+// dispatched through wsActionHandler instead of the usual actionHandler.
 func (r *Routes) addAction(s string, methods map[string]bool, ctype reflect.Type, actionName string) error {
-	handler := &actionHandler{app: r.app, methods: methods, ctype: ctype, handler: actionName}
-
-	if !strings.ContainsAny(s, "*?") {
-		r.mapRoutes[s] = handler
-		return nil
-	}
-
-	cr, err := regexp.Compile(s)
-	if err != nil {
-		return err
+	if isWebSocketAction(ctype, actionName) {
+		// Clear any previous actionHandler so Handle(...).With(...) can't
+		// silently attach middleware to an unrelated earlier route; a WS
+		// route has no chain of its own yet, so RouteBuilder.With fails
+		// loudly instead.
+		r.lastAdded = nil
+		return r.tree.insert(s, methods, &wsActionHandler{app: r.app, ctype: ctype, handler: actionName})
 	}
 
-	handler.cr = cr
-	r.rgRoutes = append(r.rgRoutes, handler)
-	return nil
+	handler := &actionHandler{app: r.app, methods: methods, ctype: ctype, handler: actionName}
+	r.lastAdded = handler
+	return r.tree.insert(s, methods, handler)
 }
 
 func (r *Routes) handle(req *http.Request, w http.ResponseWriter) {
@@ -243,37 +300,37 @@ func (r *Routes) handle(req *http.Request, w http.ResponseWriter) {
 	tm := time.Now().UTC()
 	w.Header().Set("Date", webTime(tm))
 
-	// search for accurate maps
 	requestPath := req.URL.Path
-	if handler, ok := r.mapRoutes[requestPath]; ok {
-		handler.Do(w, req)
+	if res, ok := r.tree.match(requestPath, method); ok {
+		r.dispatch(w, req, res)
 		return
-	}
-
-	// range for unaccurate slice
-	for _, handler := range r.rgRoutes {
-		if !handler.cr.MatchString(requestPath) {
-			continue
-		}
-
-		match := handler.cr.FindStringSubmatch(requestPath)
-		if len(match[0]) != len(requestPath) {
-			continue
-		}
-
-		handler.DoCr(w, req, match[1:])
+	} else if res != nil && res.methodNotAllowed {
+		(&errorHandler{app: r.app, err: newHTTPError(http.StatusMethodNotAllowed, "Method Not Allowed", nil)}).Do(w, req)
 		return
 	}
 
 	// test if default html page exists.
 	for _, page := range r.defaultIndex {
 		idxPath := path.Join(requestPath, page)
-		if handler, ok := r.mapRoutes[idxPath]; ok {
-			handler.Do(w, req)
+		if res, ok := r.tree.match(idxPath, method); ok {
+			r.dispatch(w, req, res)
 			return
 		}
 	}
 
 	// if there is not, then return 404
-	//notFound(req, w)
+	(&errorHandler{app: r.app, err: NotFound("Not Found")}).Do(w, req)
+}
+
+// dispatch runs the matched handler. *actionHandler already wraps itself in
+// the global + per-route middleware chain (see actionHandler.chain), so it's
+// called directly; every other handler kind (static, WebDAV, WebSocket, ...)
+// has no chain of its own, so it's run through runWithGlobalMiddleware here
+// instead, to honor the same "every route" guarantee App.Use documents.
+func (r *Routes) dispatch(w http.ResponseWriter, req *http.Request, res *matchResult) {
+	if ah, isAction := res.handler.(*actionHandler); isAction {
+		ah.DoParams(w, req, res.positional, res.params)
+		return
+	}
+	r.app.runWithGlobalMiddleware(w, req, res.handler.Do)
 }
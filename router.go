@@ -0,0 +1,263 @@
+package xweb
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// paramKind identifies how a {name} path segment is converted and matched.
+type paramKind int
+
+const (
+	paramString paramKind = iota
+	paramInt
+	paramUUID
+	paramPath   // matches the remainder of the path, slashes included; must be last
+	paramRegexp // matches a user-supplied regexp
+)
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// routeNode is one segment of the compiled route trie. A request path is
+// matched by walking child-by-child: literal segments first, falling back
+// to the param/wildcard children, tried in turn, when no literal matches.
+type routeNode struct {
+	part     string
+	param    *routeParam
+	children []*routeNode
+
+	// handlers is keyed by HTTP method; the "*" key means "any method",
+	// which is how static (non-action) handlers registered via addStatic
+	// behave today.
+	handlers map[string]handler
+}
+
+type routeParam struct {
+	name string
+	kind paramKind
+	re   *regexp.Regexp
+}
+
+// routeTree is the radix-style router that replaces the old mapRoutes +
+// rgRoutes linear scan. Registration still accepts the legacy `*`/`?` glob
+// patterns; they're translated to a paramRegexp node so both registration
+// styles land in the same tree.
+type routeTree struct {
+	root *routeNode
+}
+
+func newRouteTree() *routeTree {
+	return &routeTree{root: &routeNode{}}
+}
+
+func splitPattern(pattern string) []string {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return nil
+	}
+	return strings.Split(pattern, "/")
+}
+
+// parseParam recognizes {name}, {name:int}, {name:uuid}, {name:path} and
+// {name:regexp:<pattern>}. A plain literal segment returns ok=false.
+func parseParam(part string) (p *routeParam, ok bool, err error) {
+	if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+		return nil, false, nil
+	}
+	inner := part[1 : len(part)-1]
+	segs := strings.SplitN(inner, ":", 3)
+	p = &routeParam{name: segs[0], kind: paramString}
+	if len(segs) == 1 {
+		return p, true, nil
+	}
+	switch segs[1] {
+	case "int":
+		p.kind = paramInt
+	case "uuid":
+		p.kind = paramUUID
+	case "path":
+		p.kind = paramPath
+	case "regexp":
+		if len(segs) != 3 {
+			return nil, false, errors.New("xweb: {name:regexp:pattern} requires a pattern")
+		}
+		p.kind = paramRegexp
+		p.re = regexp.MustCompile(segs[2])
+	default:
+		return nil, false, errors.New("xweb: unknown path parameter type " + segs[1])
+	}
+	return p, true, nil
+}
+
+// globToParam turns a legacy `*`/`?` glob segment into the equivalent
+// paramRegexp node, so old-style registrations compile into the same tree.
+func globToParam(part string) *routeParam {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range part {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return &routeParam{name: "_", kind: paramRegexp, re: regexp.MustCompile(b.String())}
+}
+
+// insert registers h for pattern restricted to methods (nil means any
+// method, used for static handlers that predate per-method dispatch).
+func (t *routeTree) insert(pattern string, methods map[string]bool, h handler) error {
+	node := t.root
+	for _, part := range splitPattern(pattern) {
+		var param *routeParam
+		var err error
+		if strings.ContainsAny(part, "*?") && !strings.HasPrefix(part, "{") {
+			param = globToParam(part)
+		} else {
+			param, _, err = parseParam(part)
+			if err != nil {
+				return err
+			}
+		}
+
+		var next *routeNode
+		for _, c := range node.children {
+			if param == nil && c.param == nil && c.part == part {
+				next = c
+				break
+			}
+			if param != nil && c.param != nil && c.param.name == param.name && c.param.kind == param.kind &&
+				(param.re == nil || c.param.re.String() == param.re.String()) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			next = &routeNode{part: part, param: param}
+			node.children = append(node.children, next)
+		}
+		node = next
+	}
+
+	if node.handlers == nil {
+		node.handlers = make(map[string]handler)
+	}
+	if methods == nil {
+		node.handlers["*"] = h
+		return nil
+	}
+	for m := range methods {
+		node.handlers[m] = h
+	}
+	return nil
+}
+
+// matchResult carries what the trie found for a request path: the handler,
+// the named params for c.Params, and the same values again in pattern
+// order so callers can keep feeding them positionally (as `match[1:]` did).
+type matchResult struct {
+	handler    handler
+	params     map[string]string
+	positional []string
+	// methodNotAllowed is true when a node matched the path but not the
+	// method, so the caller can answer 405 instead of 404.
+	methodNotAllowed bool
+}
+
+func (t *routeTree) match(path, method string) (*matchResult, bool) {
+	parts := splitPattern(path)
+	res := &matchResult{params: map[string]string{}}
+	node, ok := t.walk(t.root, parts, res)
+	if !ok {
+		return nil, false
+	}
+	if node.handlers == nil {
+		return nil, false
+	}
+	h, ok := node.handlers[method]
+	if !ok {
+		h, ok = node.handlers["*"]
+	}
+	if !ok {
+		res.methodNotAllowed = true
+		return res, false
+	}
+	res.handler = h
+	return res, true
+}
+
+func (t *routeTree) walk(node *routeNode, parts []string, res *matchResult) (*routeNode, bool) {
+	if len(parts) == 0 {
+		return node, true
+	}
+	part := parts[0]
+
+	// literal children are tried before param children, so the most
+	// specific registration wins.
+	for _, c := range node.children {
+		if c.param == nil && c.part == part {
+			if n, ok := t.walk(c, parts[1:], res); ok {
+				return n, true
+			}
+		}
+	}
+	// Typed/regexp/string param children are tried before {:path}
+	// catch-alls, regardless of registration order, so a catch-all
+	// registered first (e.g. "/static/{rest:path}") can never shadow a
+	// more specific typed sibling (e.g. "/static/{id:int}") registered
+	// after it.
+	var pathChildren []*routeNode
+	for _, c := range node.children {
+		if c.param == nil {
+			continue
+		}
+		if c.param.kind == paramPath {
+			pathChildren = append(pathChildren, c)
+			continue
+		}
+		switch c.param.kind {
+		case paramInt:
+			if _, err := strconv.Atoi(part); err != nil {
+				continue
+			}
+		case paramUUID:
+			if !uuidRe.MatchString(part) {
+				continue
+			}
+		case paramRegexp:
+			if !c.param.re.MatchString(part) {
+				continue
+			}
+		}
+		if c.param.name != "_" {
+			res.params[c.param.name] = part
+			res.positional = append(res.positional, part)
+		}
+		if n, ok := t.walk(c, parts[1:], res); ok {
+			return n, true
+		}
+		if c.param.name != "_" {
+			delete(res.params, c.param.name)
+			res.positional = res.positional[:len(res.positional)-1]
+		}
+	}
+
+	// {:path} catch-alls are the lowest-priority fallback: they consume the
+	// rest of the path outright, so nothing can backtrack past one, which
+	// is exactly why every other kind above gets first refusal.
+	for _, c := range pathChildren {
+		value := strings.Join(parts, "/")
+		if c.param.name != "_" {
+			res.params[c.param.name] = value
+			res.positional = append(res.positional, value)
+		}
+		return c, true
+	}
+	return nil, false
+}
@@ -0,0 +1,68 @@
+package xweb
+
+import "testing"
+
+// namedHandler lets tests identify which registered route matched by name,
+// since routeTree.match hands back the generic `handler` interface.
+// Embedding it (left nil) satisfies the interface without needing a real
+// Do implementation -- these tests never invoke it.
+type namedHandler struct {
+	handler
+	name string
+}
+
+func newNamed(name string) *namedHandler { return &namedHandler{name: name} }
+
+func TestRouteTreeTypedParamWinsOverPathFallback(t *testing.T) {
+	tree := newRouteTree()
+
+	catchAll := newNamed("catch-all")
+	typed := newNamed("typed")
+
+	// Register the catch-all FIRST -- the bug this guards against made
+	// registration order, not specificity, decide which one matched.
+	if err := tree.insert("/static/{rest:path}", nil, catchAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.insert("/static/{id:int}", nil, typed); err != nil {
+		t.Fatal(err)
+	}
+
+	res, ok := tree.match("/static/42", "GET")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	got := res.handler.(*namedHandler)
+	if got.name != "typed" {
+		t.Fatalf("expected the typed {id:int} route to win, got %q", got.name)
+	}
+	if res.params["id"] != "42" {
+		t.Fatalf("expected id param 42, got %q", res.params["id"])
+	}
+}
+
+func TestRouteTreePathFallbackStillMatchesNonInt(t *testing.T) {
+	tree := newRouteTree()
+
+	catchAll := newNamed("catch-all")
+	typed := newNamed("typed")
+
+	if err := tree.insert("/static/{rest:path}", nil, catchAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.insert("/static/{id:int}", nil, typed); err != nil {
+		t.Fatal(err)
+	}
+
+	res, ok := tree.match("/static/css/app.css", "GET")
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	got := res.handler.(*namedHandler)
+	if got.name != "catch-all" {
+		t.Fatalf("expected the {rest:path} fallback to match a non-int segment, got %q", got.name)
+	}
+	if res.params["rest"] != "css/app.css" {
+		t.Fatalf("expected rest param css/app.css, got %q", res.params["rest"])
+	}
+}
@@ -0,0 +1,214 @@
+package xweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// StaticCacheConfig bounds the two-tier cache staticHandler uses for
+// compressible assets: an in-memory LRU plus .gz/.br sidecar files on disk.
+// Either tier can be disabled by leaving its field at zero.
+type StaticCacheConfig struct {
+	Dir            string // sidecar directory; "" disables the disk tier
+	MaxMemoryBytes int64  // in-memory LRU budget; 0 disables the memory tier
+}
+
+type staticCacheKey struct {
+	path     string
+	modTime  int64
+	encoding string
+}
+
+type staticCacheEntry struct {
+	key     staticCacheKey
+	content []byte
+	etag    string
+}
+
+// staticLRU is a byte-budget bounded LRU for compressed static asset
+// bodies, keyed by (path, mtime, encoding) so either a changed source file
+// or a different negotiated encoding naturally misses.
+type staticLRU struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List
+	items    map[staticCacheKey]*list.Element
+}
+
+func newStaticLRU(maxBytes int64) *staticLRU {
+	return &staticLRU{maxBytes: maxBytes, ll: list.New(), items: map[staticCacheKey]*list.Element{}}
+}
+
+func (c *staticLRU) get(key staticCacheKey) (*staticCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*staticCacheEntry), true
+}
+
+func (c *staticLRU) add(entry *staticCacheEntry) {
+	if c.maxBytes <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[entry.key]; ok {
+		c.curBytes += int64(len(entry.content)) - int64(len(el.Value.(*staticCacheEntry).content))
+		el.Value = entry
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[entry.key] = c.ll.PushFront(entry)
+		c.curBytes += int64(len(entry.content))
+	}
+	for c.curBytes > c.maxBytes {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		old := back.Value.(*staticCacheEntry)
+		c.ll.Remove(back)
+		delete(c.items, old.key)
+		c.curBytes -= int64(len(old.content))
+	}
+}
+
+// initStaticCache lazily builds the in-memory LRU the first time a static
+// request needs it. a.staticCacheOnce guards the build so concurrent
+// request goroutines can't race on reading/writing the a.staticLRU pointer.
+func (a *App) initStaticCache() {
+	a.staticCacheOnce.Do(func() {
+		if a.StaticCache.MaxMemoryBytes > 0 {
+			a.staticLRU = newStaticLRU(a.StaticCache.MaxMemoryBytes)
+		}
+	})
+}
+
+// negotiateEncoding picks the compression static assets are served with,
+// preferring Brotli over gzip when the client advertises both. This is the
+// static-serving counterpart of GetAcceptEncodingZip, extended for br.
+func negotiateEncoding(req *http.Request) string {
+	ae := req.Header.Get("Accept-Encoding")
+	if strings.Contains(ae, "br") {
+		return "br"
+	}
+	if strings.Contains(ae, "gzip") {
+		return "gzip"
+	}
+	return ""
+}
+
+func extensionFor(encoding string) string {
+	if encoding == "br" {
+		return ".br"
+	}
+	return ".gz"
+}
+
+// sidecarPath returns where the compressed copy of staticFile for encoding
+// lives inside the disk cache directory.
+func sidecarPath(dir, staticFile, encoding string) string {
+	sum := sha256.Sum256([]byte(staticFile))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+extensionFor(encoding))
+}
+
+// compress returns src compressed with encoding. encoding == "" means the
+// client advertised no Accept-Encoding xweb supports, so src is returned
+// unchanged -- callers must not set a Content-Encoding header for it.
+func compress(encoding string, src io.Reader) ([]byte, error) {
+	if encoding == "" {
+		return io.ReadAll(src)
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "br" {
+		w = brotli.NewWriter(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// staticETag computes a strong ETag from the one combination of inputs that
+// determines a static response's bytes: size, mtime and the negotiated
+// encoding. Two different encodings of the same file get different ETags.
+func staticETag(size int64, modTime time.Time, encoding string) string {
+	return fmt.Sprintf(`"%x-%x-%s"`, size, modTime.UnixNano(), encoding)
+}
+
+// loadCompressed returns the compressed bytes and ETag for staticFile under
+// encoding, consulting the in-memory LRU then the on-disk sidecar before
+// falling back to compressing the source, in which case both tiers are
+// populated for next time.
+func (a *App) loadCompressed(staticFile string, finfo os.FileInfo, encoding string) ([]byte, string, error) {
+	key := staticCacheKey{path: staticFile, modTime: finfo.ModTime().UnixNano(), encoding: encoding}
+	etag := staticETag(finfo.Size(), finfo.ModTime(), encoding)
+
+	if a.staticLRU != nil {
+		if entry, ok := a.staticLRU.get(key); ok {
+			return entry.content, entry.etag, nil
+		}
+	}
+
+	dir := a.StaticCache.Dir
+	if encoding == "" {
+		// Only compressed bodies get a sidecar; an identity body would
+		// otherwise share the .gz sidecar path with the gzip one.
+		dir = ""
+	}
+	if dir != "" {
+		sidecar := sidecarPath(dir, staticFile, encoding)
+		if sinfo, err := os.Stat(sidecar); err == nil && !sinfo.ModTime().Before(finfo.ModTime()) {
+			if content, err := os.ReadFile(sidecar); err == nil {
+				if a.staticLRU != nil {
+					a.staticLRU.add(&staticCacheEntry{key: key, content: content, etag: etag})
+				}
+				return content, etag, nil
+			}
+		}
+	}
+
+	src, err := os.Open(staticFile)
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+
+	content, err := compress(encoding, src)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			os.WriteFile(sidecarPath(dir, staticFile, encoding), content, 0644)
+		}
+	}
+	if a.staticLRU != nil {
+		a.staticLRU.add(&staticCacheEntry{key: key, content: content, etag: etag})
+	}
+	return content, etag, nil
+}
@@ -0,0 +1,66 @@
+package xweb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newStaticLRU(10)
+
+	a := &staticCacheEntry{key: staticCacheKey{path: "a", encoding: "gzip"}, content: make([]byte, 6), etag: "a"}
+	b := &staticCacheEntry{key: staticCacheKey{path: "b", encoding: "gzip"}, content: make([]byte, 6), etag: "b"}
+
+	c.add(a)
+	c.add(b) // now over budget (12 > 10); "a" should be evicted
+
+	if _, ok := c.get(a.key); ok {
+		t.Fatal("expected a to be evicted once the budget was exceeded")
+	}
+	if _, ok := c.get(b.key); !ok {
+		t.Fatal("expected b, the most recently added entry, to still be cached")
+	}
+}
+
+func TestStaticLRUKeyIncludesEncodingAndMtime(t *testing.T) {
+	c := newStaticLRU(1 << 20)
+
+	gz := &staticCacheEntry{key: staticCacheKey{path: "app.js", modTime: 1, encoding: "gzip"}, content: []byte("gz"), etag: "gz-etag"}
+	br := &staticCacheEntry{key: staticCacheKey{path: "app.js", modTime: 1, encoding: "br"}, content: []byte("br"), etag: "br-etag"}
+	updated := &staticCacheEntry{key: staticCacheKey{path: "app.js", modTime: 2, encoding: "gzip"}, content: []byte("gz2"), etag: "gz2-etag"}
+
+	c.add(gz)
+	c.add(br)
+	c.add(updated)
+
+	if got, ok := c.get(gz.key); !ok || string(got.content) != "gz" {
+		t.Fatalf("gzip entry at mtime 1 should still be cached independently of br, got %+v ok=%v", got, ok)
+	}
+	if got, ok := c.get(br.key); !ok || string(got.content) != "br" {
+		t.Fatalf("br entry should be cached independently of gzip, got %+v ok=%v", got, ok)
+	}
+	if got, ok := c.get(updated.key); !ok || string(got.content) != "gz2" {
+		t.Fatalf("a newer mtime is a distinct key, not a stale hit, got %+v ok=%v", got, ok)
+	}
+}
+
+func TestCompressIdentityPassthroughWhenNoEncoding(t *testing.T) {
+	got, err := compress("", strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte("hello world")) {
+		t.Fatalf("expected compress(\"\", ...) to pass the body through unchanged, got %q", got)
+	}
+}
+
+func TestStaticETagDiffersByEncoding(t *testing.T) {
+	mt := time.Unix(1700000000, 0)
+	gz := staticETag(100, mt, "gzip")
+	br := staticETag(100, mt, "br")
+	if gz == br {
+		t.Fatal("expected gzip and br encodings of the same file to get different ETags")
+	}
+}
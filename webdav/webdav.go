@@ -0,0 +1,58 @@
+// Package webdav mounts a WebDAV root into an xweb app. It delegates the
+// protocol details (PROPFIND/PROPPATCH XML bodies, lock tokens, COPY/MOVE
+// semantics, ...) to golang.org/x/net/webdav and just adapts its Handler to
+// the shape xweb.Routes dispatches against.
+package webdav
+
+import (
+	"net/http"
+
+	xnetwebdav "golang.org/x/net/webdav"
+)
+
+// Dir, FileSystem and LockSystem are re-exported from golang.org/x/net/webdav
+// so callers configuring a mount don't need that import themselves.
+type (
+	Dir        = xnetwebdav.Dir
+	FileSystem = xnetwebdav.FileSystem
+	LockSystem = xnetwebdav.LockSystem
+)
+
+// NewMemLS returns an in-memory LockSystem, enough for a single-process
+// xweb app. Pass a different LockSystem in Config to share locks across
+// processes.
+func NewMemLS() LockSystem {
+	return xnetwebdav.NewMemLS()
+}
+
+// Config configures a WebDAV root mounted with App.MountWebDAV.
+type Config struct {
+	FS         FileSystem
+	LockSystem LockSystem
+}
+
+// Handler serves every WebDAV verb (PROPFIND, PROPPATCH, MKCOL, COPY, MOVE,
+// LOCK, UNLOCK, GET, ...) against Config.FS. It satisfies xweb's internal
+// `handler` interface (Do(http.ResponseWriter, *http.Request) error)
+// structurally, so App.MountWebDAV can register it like any other route.
+type Handler struct {
+	inner *xnetwebdav.Handler
+}
+
+// NewHandler builds a Handler ready to be registered with App.MountWebDAV.
+// prefix is the mount point (e.g. "/files"); it's stripped from incoming
+// request paths before they're resolved against cfg.FS, the same way
+// golang.org/x/net/webdav.Handler.Prefix always has worked.
+func NewHandler(prefix string, cfg Config) *Handler {
+	return &Handler{inner: &xnetwebdav.Handler{
+		Prefix:     prefix,
+		FileSystem: cfg.FS,
+		LockSystem: cfg.LockSystem,
+	}}
+}
+
+// Do implements the handler interface xweb.Routes dispatches against.
+func (h *Handler) Do(w http.ResponseWriter, req *http.Request) error {
+	h.inner.ServeHTTP(w, req)
+	return nil
+}
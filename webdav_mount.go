@@ -0,0 +1,46 @@
+package xweb
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/yonsy/xweb/webdav"
+)
+
+// webdavHandler adapts a mounted webdav.Handler to xweb's handler
+// interface: it strips App.BasePath the same way staticHandler does, and
+// runs GET requests through GzipMiddleware so WebDAV file downloads get the
+// same compression static assets already do. A WebDAV route has no
+// per-route middleware, so the CheckXrsf cookie/form check (XSRFMiddleware)
+// runs for it only if XSRFMiddleware was registered globally with App.Use.
+type webdavHandler struct {
+	app *App
+	wh  *webdav.Handler
+}
+
+func (h *webdavHandler) Do(w http.ResponseWriter, req *http.Request) error {
+	if trimmed := strings.TrimPrefix(req.URL.Path, h.app.BasePath); trimmed != req.URL.Path {
+		req.URL.Path = trimmed
+	}
+
+	serve := HandlerFunc(h.wh.Do)
+	if req.Method == "GET" && h.app.Server.Config.EnableGzip {
+		serve = GzipMiddleware(serve)
+	}
+	return serve(w, req)
+}
+
+// MountWebDAV registers a WebDAV root at prefix (e.g. "/files") so its
+// verbs participate in the normal Routes dispatch alongside controllers
+// and static files. prefix is handed to webdav.NewHandler so it's stripped
+// before resolving against cfg.FS -- a GET to "/files/report.docx" with
+// cfg.FS rooted at "/srv/data" resolves to "/srv/data/report.docx", not
+// "/srv/data/files/report.docx".
+func (a *App) MountWebDAV(prefix string, cfg webdav.Config) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	h := &webdavHandler{app: a, wh: webdav.NewHandler(prefix, cfg)}
+	if err := a.Routes.tree.insert(prefix, nil, h); err != nil {
+		return err
+	}
+	return a.Routes.tree.insert(prefix+"/{path:path}", nil, h)
+}
@@ -0,0 +1,157 @@
+package xweb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketConfig controls the upgrade wsActionHandler performs for actions
+// recognized as WebSocket handlers (see isWebSocketAction). There are
+// deliberately no ReadBufferSize/WriteBufferSize knobs: golang.org/x/net/websocket
+// has no equivalent of gorilla/websocket's buffered upgrader, so those
+// would be config that silently does nothing.
+type WebSocketConfig struct {
+	AllowedOrigins []string
+	Subprotocols   []string
+	PingInterval   time.Duration
+	MaxMessageSize int64
+}
+
+var wsConnType = reflect.TypeOf(&websocket.Conn{})
+
+// reflectNilResult stands in for the After hook's actionResult argument on
+// routes that don't produce one, such as WebSocket handlers.
+var reflectNilResult = reflect.Zero(reflect.TypeOf((*interface{})(nil)).Elem())
+
+// isWebSocketAction reports whether actionName, called on *ctype, has the
+// `func(ws *websocket.Conn)` shape addAction treats as a WebSocket endpoint
+// to upgrade instead of running through the normal safelyCall pipeline.
+func isWebSocketAction(ctype reflect.Type, actionName string) bool {
+	m, ok := reflect.PtrTo(ctype).MethodByName(actionName)
+	if !ok {
+		return false
+	}
+	// In(0) is the receiver.
+	return m.Type.NumIn() == 2 && m.Type.In(1) == wsConnType
+}
+
+// wsActionHandler performs the HTTP upgrade for an action recognized by
+// isWebSocketAction. Routing and XSRF exemption work as for other routes.
+// The Before/After hooks run around the action call once the upgrade has
+// completed, so Before cannot refuse the upgrade; Init is not called. The
+// action is called with a live *websocket.Conn instead of having its
+// return value written out.
+type wsActionHandler struct {
+	app     *App
+	ctype   reflect.Type
+	handler string
+}
+
+func (h *wsActionHandler) Do(w http.ResponseWriter, req *http.Request) error {
+	a := h.app
+	server := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			return h.checkOrigin(r)
+		},
+		Handler: h.serve(req, w),
+	}
+	if len(a.WebSocket.Subprotocols) > 0 {
+		server.Config.Protocol = a.WebSocket.Subprotocols
+	}
+	server.ServeHTTP(w, req)
+	return nil
+}
+
+func (h *wsActionHandler) checkOrigin(r *http.Request) error {
+	allowed := h.app.WebSocket.AllowedOrigins
+	if len(allowed) == 0 {
+		return nil
+	}
+	origin := r.Header.Get("Origin")
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("xweb: origin %q not allowed", origin)
+}
+
+func (h *wsActionHandler) serve(req *http.Request, w http.ResponseWriter) websocket.Handler {
+	a := h.app
+	return func(ws *websocket.Conn) {
+		if a.WebSocket.MaxMessageSize > 0 {
+			ws.MaxPayloadBytes = int(a.WebSocket.MaxMessageSize)
+		}
+		defer ws.Close()
+
+		if a.WebSocket.PingInterval > 0 {
+			stop := make(chan struct{})
+			defer close(stop)
+			go h.heartbeat(ws, a.WebSocket.PingInterval, stop)
+		}
+
+		vc := reflect.New(h.ctype)
+		c := Action{Request: req, App: a, ResponseWriter: w, T: T{}, f: T{}, Params: paramsFromContext(req)}
+		for k, v := range a.VarMaps {
+			c.T[k] = v
+		}
+		if fieldA := vc.Elem().FieldByName("Action"); fieldA.IsValid() {
+			fieldA.Set(reflect.ValueOf(c))
+		}
+		if fieldC := vc.Elem().FieldByName("C"); fieldC.IsValid() {
+			fieldC.Set(reflect.ValueOf(vc))
+		}
+		a.StructMap(vc.Elem(), req)
+
+		structName := reflect.ValueOf(h.ctype.String())
+		actionName := reflect.ValueOf(h.handler)
+		if before := vc.MethodByName("Before"); before.IsValid() {
+			before.Call([]reflect.Value{structName, actionName})
+		}
+
+		vc.MethodByName(h.handler).Call([]reflect.Value{reflect.ValueOf(ws)})
+
+		if after := vc.MethodByName("After"); after.IsValid() {
+			after.Call([]reflect.Value{structName, actionName, reflectNilResult})
+		}
+	}
+}
+
+// heartbeat sends an empty text message every interval until stop is closed.
+// golang.org/x/net/websocket has no distinct control frames, so this is a
+// best-effort keepalive rather than a protocol-level ping.
+func (h *wsActionHandler) heartbeat(ws *websocket.Conn, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := websocket.Message.Send(ws, ""); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// PipeStream proxies data bidirectionally between ws and backend until
+// either side closes or errors, e.g. for tunneling a WebSocket to another
+// connection-oriented service.
+func PipeStream(ws *websocket.Conn, backend io.ReadWriter) error {
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(backend, ws)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(ws, backend)
+		errc <- err
+	}()
+	return <-errc
+}